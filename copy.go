@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ctxQuerier is satisfied by both *sql.DB and *sql.Conn, so fetchChunk can
+// read through a plain pooled connection or through the dedicated
+// connection holding a consistent snapshot transaction open.
+type ctxQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// writeRetries is how many times a chunk write is retried after a transient
+// error before copyTable gives up on the table.
+const writeRetries = 3
+
+// copyTable runs the full copy pipeline for a single source/target table
+// pair: create the schema/table on the target if needed, then stream rows
+// across in fixed-size primary-key range chunks so a large table can be
+// interrupted and resumed instead of restarting from scratch. When
+// consistent is true all chunk reads run inside one snapshot transaction
+// captured via startConsistentSnapshot.
+func copyTable(source, target *dbInfo, appendOnly, ignore, verbose bool, chunkSize int, resume *resumeState, loader string, consistent bool) (uint, *binlogCoords, error) {
+	tableKey := source.schema + "." + source.table
+
+	if entry, ok := resume.get(tableKey); ok && entry.Done {
+		logger.Infof("skipping %s - already completed per %s", tableKey, resume.path)
+		return 0, nil, nil
+	}
+
+	// A non-Done resume entry means a prior run left off partway through
+	// this table. Dropping and recreating the target here would delete the
+	// rows already copied while the resume boundary still points past them,
+	// silently losing that range. Refuse instead of guessing what the user
+	// wants.
+	if entry, ok := resume.get(tableKey); ok && !entry.Done && !appendOnly {
+		return 0, nil, fmt.Errorf("%s has in-progress resume state in %s - rerun with -append to continue from it, or remove the entry to start over", tableKey, resume.path)
+	}
+
+	// Get create table statement
+	createStmt, err := source.getCreateTable()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Get table column data types
+	target.columns, err = source.getDataTypes()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Only (re)create the schema & table if not appending
+	if !appendOnly {
+		// Create the target schema if it does not already exist
+		if err := createSchema(source, target, verbose); err != nil {
+			return 0, nil, err
+		}
+
+		// Drop and recreate the target table
+		if err := createTable(source, target, createStmt); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	pkCols, err := getPrimaryKeyColumns(source)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var lowerBound []string
+	var offset int64
+	if entry, ok := resume.get(tableKey); ok {
+		lowerBound = entry.Values
+		offset = entry.Offset
+	}
+
+	useInfile := loader != "insert"
+	if useInfile && !localInfileEnabled(target) {
+		logger.Warnf("local_infile is OFF on %s - falling back to INSERT statements", target.host+target.port)
+		useInfile = false
+	}
+
+	ctx := context.Background()
+	var q ctxQuerier = source.db
+	var tableCoords *binlogCoords
+	if consistent {
+		conn, snapCoords, err := startConsistentSnapshot(ctx, source)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer endConsistentSnapshot(ctx, conn)
+
+		q = conn
+		tableCoords = &snapCoords
+	}
+
+	var rowsWritten uint
+	for {
+		chunk, newBound, newOffset, err := fetchChunk(ctx, q, source, pkCols, lowerBound, offset, chunkSize)
+		if err != nil {
+			return rowsWritten, tableCoords, err
+		}
+
+		if len(chunk) > 0 {
+			write := func() error {
+				if useInfile {
+					return target.writeChunkInfile(chunk, ignore)
+				}
+				return target.writeChunk(chunk, ignore)
+			}
+			if err := withRetry(writeRetries, write); err != nil {
+				return rowsWritten, tableCoords, err
+			}
+			rowsWritten += uint(len(chunk))
+			metrics.addRows(tableKey, uint64(len(chunk)))
+			metrics.addChunk(tableKey)
+		}
+
+		done := len(chunk) < chunkSize
+		if err := resume.set(tableKey, resumeEntry{Columns: pkCols, Values: newBound, Offset: newOffset, Done: done}); err != nil {
+			return rowsWritten, tableCoords, err
+		}
+
+		if verbose && len(chunk) > 0 {
+			logger.Debugf("%s: wrote chunk of %d rows (%d total)", tableKey, len(chunk), rowsWritten)
+		}
+
+		if done {
+			break
+		}
+
+		lowerBound, offset = newBound, newOffset
+	}
+
+	return rowsWritten, tableCoords, nil
+}
+
+// withRetry runs fn up to n+1 times, retrying on error with a short backoff
+// and recording each retry on the metrics endpoint. It's meant for the
+// per-chunk target write, where a transient network blip shouldn't fail an
+// otherwise healthy multi-GB copy.
+func withRetry(n int, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= n; attempt++ {
+		if attempt > 0 {
+			metrics.addRetry()
+			logger.Warnf("retrying after error: %v", err)
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// fetchChunk reads up to chunkSize rows starting just past lowerBound (or
+// offset, when the table has neither a primary key nor a usable unique key)
+// and returns them along with the boundary the next call should resume from.
+func fetchChunk(ctx context.Context, q ctxQuerier, src *dbInfo, pkCols []string, lowerBound []string, offset int64, chunkSize int) ([][]sql.RawBytes, []string, int64, error) {
+	query, args := buildChunkQuery(src, pkCols, lowerBound, offset, chunkSize)
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	pkIdx := make([]int, len(pkCols))
+	for i, pkCol := range pkCols {
+		pkIdx[i] = -1
+		for j, col := range cols {
+			if col == pkCol {
+				pkIdx[i] = j
+				break
+			}
+		}
+	}
+
+	var chunk [][]sql.RawBytes
+	var lastPK []string
+
+	for rows.Next() {
+		vals := make([]sql.RawBytes, len(cols))
+		scanVals := make([]interface{}, len(cols))
+		for i := range vals {
+			scanVals[i] = &vals[i]
+		}
+
+		if err := rows.Scan(scanVals...); err != nil {
+			return nil, nil, 0, err
+		}
+
+		chunk = append(chunk, vals)
+
+		if len(pkCols) > 0 {
+			lastPK = make([]string, len(pkCols))
+			for i, idx := range pkIdx {
+				if idx >= 0 {
+					lastPK[i] = string(vals[idx])
+				}
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if len(pkCols) > 0 {
+		if lastPK == nil {
+			lastPK = lowerBound
+		}
+		return chunk, lastPK, 0, nil
+	}
+
+	return chunk, nil, offset + int64(len(chunk)), nil
+}
+
+// buildChunkQuery builds the select statement for one chunk. Tables with a
+// primary key or usable unique key are walked in key order using the
+// lexicographic "greater than" predicate from pkPredicate; tables with
+// neither fall back to LIMIT/OFFSET.
+func buildChunkQuery(src *dbInfo, pkCols []string, lowerBound []string, offset int64, chunkSize int) (string, []interface{}) {
+	base := "select * from " + addQuotes(src.schema) + "." + addQuotes(src.table)
+
+	if len(pkCols) == 0 {
+		return base + src.where + " limit " + strconv.Itoa(chunkSize) + " offset " + strconv.FormatInt(offset, 10), nil
+	}
+
+	where := src.where
+	predicate, args := pkPredicate(pkCols, lowerBound)
+	if predicate != "" {
+		if where == "" {
+			where = " where " + predicate
+		} else {
+			where = where + " and " + predicate
+		}
+	}
+
+	orderCols := make([]string, len(pkCols))
+	for i, c := range pkCols {
+		orderCols[i] = addQuotes(c)
+	}
+
+	query := base + where + " order by " + strings.Join(orderCols, ", ") + " limit " + strconv.Itoa(chunkSize)
+
+	return query, args
+}
+
+// Adds backtick quotes in cases where identifiers are all numeric or match reserved keywords
+func addQuotes(s string) string {
+	s = "`" + s + "`"
+	return s
+}
+
+// Get create table statement
+func (dbi *dbInfo) getCreateTable() (string, error) {
+	var ignore string
+	var stmt string
+	err := dbi.db.QueryRow("show create table " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table)).Scan(&ignore, &stmt)
+	return stmt, err
+}
+
+// Get column data types
+func (dbi *dbInfo) getDataTypes() ([]string, error) {
+	var cols = []string{}
+	rows, err := dbi.db.Query("select data_type from information_schema.columns where table_schema = '" + dbi.schema + "' and table_name = '" + dbi.table + "'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dataType string
+	for rows.Next() {
+		if err := rows.Scan(&dataType); err != nil {
+			return nil, err
+		}
+		cols = append(cols, dataType)
+	}
+
+	return cols, rows.Err()
+}
+
+// Create the target schema if it does not already exist
+func createSchema(src, tgt *dbInfo, verbose bool) error {
+	var exists string
+	err := tgt.db.QueryRow("show databases like '" + tgt.schema + "'").Scan(&exists)
+	if err == nil {
+		return nil
+	}
+
+	var charSet string
+	if err := src.db.QueryRow("select default_character_set_name from information_schema.schemata where schema_name = '" + src.schema + "'").Scan(&charSet); err != nil {
+		return err
+	}
+
+	if _, err := tgt.db.Exec("create database " + addQuotes(tgt.schema) + " default character set " + charSet); err != nil {
+		return err
+	}
+
+	logger.Infof("created schema %s", tgt.schema)
+
+	return nil
+}
+
+// Drop and recreate the target table
+func createTable(src, tgt *dbInfo, tableCreate string) error {
+	// Start db transaction
+	tx, err := tgt.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Only turn off foreign key checks when the caller told us the computed
+	// dependency order can't be trusted (a cycle, or no order was computed
+	// at all); otherwise leave them on so that order is actually enforced.
+	if tgt.disableFKChecks {
+		if _, err := tx.Exec("set foreign_key_checks=0"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("use " + tgt.schema); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Drop table if exists
+	if _, err := tx.Exec("drop table if exists " + addQuotes(tgt.table)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Change table name if different
+	if src.table != tgt.table {
+		tableCreate = strings.Replace(tableCreate, src.table, tgt.table, 1)
+	}
+
+	// Create table
+	if _, err := tx.Exec(tableCreate); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// writeChunk wraps insert syntax around a fixed batch of rows and commits it
+// to the target in its own transaction, splitting into multiple statements
+// if the batch is larger than insertBufferSize.
+func (dbi *dbInfo) writeChunk(chunk [][]sql.RawBytes, ignore bool) error {
+	buf := bytes.NewBuffer(make([]byte, 0, insertBufferSize))
+
+	var sqlPrefix string
+	if ignore {
+		sqlPrefix = "insert ignore into " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + " values ("
+	} else {
+		sqlPrefix = "insert into " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + " values ("
+	}
+	prefixLength, _ := buf.WriteString(sqlPrefix)
+
+	appendSQL := false
+	for _, data := range chunk {
+		if appendSQL {
+			buf.WriteString(",(")
+		}
+		appendSQL = true
+
+		for i, col := range data {
+			if col == nil {
+				buf.WriteString("NULL")
+			} else if len(col) == 0 {
+				buf.WriteString("''")
+			} else {
+				switch dbi.columns[i] {
+				case "tinytext":
+					fallthrough
+				case "text":
+					fallthrough
+				case "mediumtext":
+					fallthrough
+				case "longtext":
+					fallthrough
+				case "char":
+					fallthrough
+				case "varchar":
+					if bytes.IndexAny(col, `\'`) >= 0 {
+						col = bytes.Replace(col, []byte(`\`), []byte(`\\`), -1)
+						col = bytes.Replace(col, []byte(`'`), []byte(`\'`), -1)
+					}
+					fallthrough
+				default:
+					buf.WriteString("'")
+					buf.Write(col)
+					buf.WriteString("'")
+				}
+			}
+
+			// All fields but the last one are comma delimited
+			if i < len(dbi.columns)-1 {
+				buf.WriteString(",")
+			}
+		}
+
+		buf.WriteString(")")
+
+		// Flush once the buffer grows past insertBufferSize so a single
+		// chunk can't build an unbounded statement.
+		if buf.Len() > insertBufferSize {
+			if err := dbi.execInsert(buf.String()); err != nil {
+				return err
+			}
+
+			buf.Reset()
+			buf.WriteString(sqlPrefix)
+			appendSQL = false
+		}
+	}
+
+	if buf.Len() > prefixLength {
+		if err := dbi.execInsert(buf.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execInsert runs a single built insert statement against the target inside
+// its own transaction, with foreign_key_checks disabled the same way the
+// table create step is when the caller told us the computed dependency
+// order can't be trusted.
+func (dbi *dbInfo) execInsert(stmt string) error {
+	tx, err := dbi.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if dbi.disableFKChecks {
+		if _, err := tx.Exec("set foreign_key_checks=0"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("use " + addQuotes(dbi.schema)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	metrics.addBytes(uint64(len(stmt)))
+
+	return tx.Commit()
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// job describes a single source/target table pair to be copied.
+type job struct {
+	source dbInfo
+	target dbInfo
+}
+
+// connPool hands out one *sql.DB per distinct host/credential combination so
+// that N concurrent table jobs against the same server share a connection
+// pool instead of each dialing their own.
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string]*dbInfo
+}
+
+var pool = &connPool{conns: make(map[string]*dbInfo)}
+
+// connKey uniquely identifies the server+credentials a dbInfo connects to,
+// independent of which schema/table it addresses.
+func (dbi *dbInfo) connKey() string {
+	if dbi.sock != "" {
+		return dbi.user + "@sock:" + dbi.sock
+	}
+	return dbi.user + "@" + dbi.host + ":" + dbi.port
+}
+
+// get returns a connected dbInfo for the given connection, reusing an
+// existing *sql.DB when one is already open for the same server/credentials.
+func (p *connPool) get(dbi dbInfo) (*dbInfo, error) {
+	key := dbi.connKey()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if existing, ok := p.conns[key]; ok {
+		dbi.db = existing.db
+		return &dbi, nil
+	}
+
+	db, err := dbi.Connect()
+	if err != nil {
+		return nil, err
+	}
+	dbi.db = db
+
+	p.conns[key] = &dbi
+
+	return &dbi, nil
+}
+
+// resolveTables expands -srctable into a list of fully qualified tables.
+// srctable may be:
+//   - a single qualified table: schema.table
+//   - a comma separated list of qualified tables: schema.t1,schema.t2
+//   - a glob: schema.* (all tables in schema matching the pattern)
+//   - a bare schema name: schema (shorthand for schema.*)
+func resolveTables(src *dbInfo, srctable string) ([]string, error) {
+	var tables []string
+
+	for _, entry := range strings.Split(srctable, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		schema, table := entry, "*"
+		if i := strings.Index(entry, "."); i >= 0 {
+			schema, table = entry[:i], entry[i+1:]
+		}
+
+		if table == "*" {
+			matches, err := tablesLike(src, schema, "%")
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, matches...)
+			continue
+		}
+
+		if strings.Contains(table, "*") {
+			matches, err := tablesLike(src, schema, strings.Replace(table, "*", "%", -1))
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, matches...)
+			continue
+		}
+
+		tables = append(tables, schema+"."+table)
+	}
+
+	return tables, nil
+}
+
+// tablesLike returns schema.table names in schema whose name matches the
+// given SQL LIKE pattern.
+func tablesLike(src *dbInfo, schema, likePattern string) ([]string, error) {
+	rows, err := src.db.Query("select table_name from information_schema.tables where table_schema = ? and table_name like ? and table_type = 'BASE TABLE'", schema, likePattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, schema+"."+table)
+	}
+
+	return tables, rows.Err()
+}
+
+// orderByDependencies groups tables into dependency levels based on
+// information_schema.KEY_COLUMN_USAGE: level 0 holds every table with no
+// unresolved dependency within the set, level 1 holds tables whose only
+// dependencies are in level 0, and so on. runJobs copies a whole level
+// concurrently and waits for it to finish before starting the next, so a
+// child table is never copied while its FK parent is still in flight. When
+// the tables contain a dependency cycle, cycle is true and levels holds a
+// single level with the original order; the caller must run that level with
+// foreign_key_checks disabled since no order can satisfy every constraint.
+func orderByDependencies(src *dbInfo, tables []string) (levels [][]string, cycle bool, err error) {
+	if len(tables) < 2 {
+		return [][]string{tables}, false, nil
+	}
+
+	inSet := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		inSet[t] = true
+	}
+
+	// child -> parents it must be copied after
+	parents := make(map[string]map[string]bool, len(tables))
+	for _, t := range tables {
+		parents[t] = map[string]bool{}
+	}
+
+	rows, err := src.db.Query(`
+		select concat(table_schema, '.', table_name) as child,
+		       concat(referenced_table_schema, '.', referenced_table_name) as parent
+		from information_schema.key_column_usage
+		where referenced_table_name is not null`)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var child, parent string
+		if err := rows.Scan(&child, &parent); err != nil {
+			return nil, false, err
+		}
+		if inSet[child] && inSet[parent] && child != parent {
+			parents[child][parent] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	levels, cycle = levelsFromParents(tables, parents)
+	if cycle {
+		// Dependency cycle - fall back to the original order and rely
+		// on foreign_key_checks=0, same as a single table copy.
+		logger.Warnf("foreign key cycle detected, copying in original order with foreign_key_checks disabled")
+		return [][]string{tables}, true, nil
+	}
+
+	return levels, false, nil
+}
+
+// levelsFromParents runs Kahn's algorithm over tables and their parents (child
+// -> set of parents it must be copied after), one frontier (level) at a time:
+// every table ready in a pass is collected before any of them are removed
+// from remaining, so a parent and its own child can never land in the same
+// level even when the child happens to be visited first in tables. cycle is
+// true when some tables never become ready, in which case levels is nil and
+// the caller must fall back to a single unordered level.
+func levelsFromParents(tables []string, parents map[string]map[string]bool) (levels [][]string, cycle bool) {
+	remaining := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		remaining[t] = true
+	}
+
+	for len(remaining) > 0 {
+		var level []string
+		for _, t := range tables {
+			if !remaining[t] {
+				continue
+			}
+
+			ready := true
+			for parent := range parents[t] {
+				if remaining[parent] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				level = append(level, t)
+			}
+		}
+
+		if len(level) == 0 {
+			return nil, true
+		}
+
+		for _, t := range level {
+			delete(remaining, t)
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, false
+}
+
+// buildJobLevels turns dependency levels into copy job levels, splitting
+// each schema.table into the per-job dbInfo the rest of the program expects.
+// disableFKChecks is stamped onto every job's target so the copy/insert path
+// knows whether it's safe to rely on the computed order (checks stay on) or
+// whether a cycle forces foreign_key_checks=0 for the whole run.
+func buildJobLevels(source, target dbInfo, levels [][]string, singleTgtTable string, disableFKChecks bool) ([][]job, error) {
+	jobLevels := make([][]job, 0, len(levels))
+
+	for _, tables := range levels {
+		jobs := make([]job, 0, len(tables))
+
+		for _, t := range tables {
+			i := strings.Index(t, ".")
+			if i < 0 {
+				return nil, fmt.Errorf("%q is not a fully qualified schema.table", t)
+			}
+
+			src := source
+			src.schema, src.table = t[:i], t[i+1:]
+
+			tgt := target
+			tgt.disableFKChecks = disableFKChecks
+			if singleTgtTable != "" {
+				// -tgttable only makes sense when copying exactly one table.
+				tj := strings.Index(singleTgtTable, ".")
+				tgt.schema, tgt.table = singleTgtTable[:tj], singleTgtTable[tj+1:]
+			} else {
+				tgt.schema, tgt.table = src.schema, src.table
+			}
+
+			jobs = append(jobs, job{source: src, target: tgt})
+		}
+
+		jobLevels = append(jobLevels, jobs)
+	}
+
+	return jobLevels, nil
+}
+
+// runJobs copies each dependency level in turn, running up to parallel jobs
+// of that level concurrently over a shared worker pool and waiting for the
+// whole level to finish before starting the next - that wait is what makes
+// the dependency order from orderByDependencies actually mean something.
+// Source and target connections are pooled per-host via the package level
+// connPool rather than dialed once per table. It returns the total rows
+// copied, any captured -consistent coordinates, and the number of jobs that
+// failed, so main() can exit non-zero on a partial failure.
+func runJobs(jobLevels [][]job, parallel int, appendOnly, ignore, verbose bool, chunkSize int, resume *resumeState, loader string, consistent bool, verify, verifyOnly bool, minVerifyChunk int) (uint, []binlogCoords, int) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var totalRows uint
+	var allCoords []binlogCoords
+	var failures int
+	var totalMu sync.Mutex
+
+	for _, jobs := range jobLevels {
+		jobChan := make(chan job)
+		var wg sync.WaitGroup
+
+		for w := 0; w < parallel; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range jobChan {
+					src, err := pool.get(j.source)
+					if err != nil {
+						logger.Errorf("%v", err)
+						totalMu.Lock()
+						failures++
+						totalMu.Unlock()
+						continue
+					}
+
+					tgt, err := pool.get(j.target)
+					if err != nil {
+						logger.Errorf("%v", err)
+						totalMu.Lock()
+						failures++
+						totalMu.Unlock()
+						continue
+					}
+					tgt.disableFKChecks = j.target.disableFKChecks
+
+					tableKey := src.schema + "." + src.table
+					tgtKey := tgt.schema + "." + tgt.table
+
+					if verifyOnly {
+						ok, err := verifyTable(src, tgt, chunkSize, minVerifyChunk)
+						totalMu.Lock()
+						if err != nil {
+							logger.Errorf("%s: %v", tableKey, err)
+							failures++
+						} else if ok {
+							logger.Infof("OK: %s matches %s", tableKey, tgtKey)
+						} else {
+							logger.Warnf("MISMATCH: %s differs from %s", tableKey, tgtKey)
+							failures++
+						}
+						totalMu.Unlock()
+						continue
+					}
+
+					logger.Infof("copying %s -> %s", tableKey, tgtKey)
+
+					rows, coords, err := copyTable(src, tgt, appendOnly, ignore, verbose, chunkSize, resume, loader, consistent)
+					if err != nil {
+						logger.Errorf("%s: %v", tableKey, err)
+						totalMu.Lock()
+						failures++
+						totalMu.Unlock()
+						continue
+					}
+
+					totalMu.Lock()
+					totalRows += rows
+					if coords != nil {
+						allCoords = append(allCoords, *coords)
+					}
+					totalMu.Unlock()
+
+					if verify {
+						ok, err := verifyTable(src, tgt, chunkSize, minVerifyChunk)
+						totalMu.Lock()
+						if err != nil {
+							logger.Errorf("%s: verify: %v", tableKey, err)
+							failures++
+						} else if ok {
+							logger.Infof("verified: %s matches %s", tableKey, tgtKey)
+						} else {
+							logger.Warnf("verify MISMATCH: %s differs from %s", tableKey, tgtKey)
+							failures++
+						}
+						totalMu.Unlock()
+					}
+				}
+			}()
+		}
+
+		for _, j := range jobs {
+			jobChan <- j
+		}
+		close(jobChan)
+
+		// Barrier: every job in this level must finish before the next
+		// level (which may depend on these tables via FK) is released.
+		wg.Wait()
+	}
+
+	return totalRows, allCoords, failures
+}
@@ -0,0 +1,95 @@
+package main
+
+import "testing"
+
+func levelsEqual(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		seen := make(map[string]bool, len(a[i]))
+		for _, t := range a[i] {
+			seen[t] = true
+		}
+		for _, t := range b[i] {
+			if !seen[t] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestLevelsFromParentsNoDependencies(t *testing.T) {
+	tables := []string{"a", "b", "c"}
+	parents := map[string]map[string]bool{
+		"a": {}, "b": {}, "c": {},
+	}
+
+	levels, cycle := levelsFromParents(tables, parents)
+	if cycle {
+		t.Fatal("unexpected cycle")
+	}
+	if !levelsEqual(levels, [][]string{{"a", "b", "c"}}) {
+		t.Fatalf("got %v", levels)
+	}
+}
+
+func TestLevelsFromParentsChain(t *testing.T) {
+	// c depends on b, b depends on a: a must land strictly before b,
+	// and b strictly before c, even though tables lists them child-first.
+	tables := []string{"c", "b", "a"}
+	parents := map[string]map[string]bool{
+		"a": {},
+		"b": {"a": true},
+		"c": {"b": true},
+	}
+
+	levels, cycle := levelsFromParents(tables, parents)
+	if cycle {
+		t.Fatal("unexpected cycle")
+	}
+	want := [][]string{{"a"}, {"b"}, {"c"}}
+	if !levelsEqual(levels, want) {
+		t.Fatalf("got %v, want %v", levels, want)
+	}
+}
+
+func TestLevelsFromParentsDiamond(t *testing.T) {
+	// b and c both depend on a; d depends on both b and c.
+	tables := []string{"a", "b", "c", "d"}
+	parents := map[string]map[string]bool{
+		"a": {},
+		"b": {"a": true},
+		"c": {"a": true},
+		"d": {"b": true, "c": true},
+	}
+
+	levels, cycle := levelsFromParents(tables, parents)
+	if cycle {
+		t.Fatal("unexpected cycle")
+	}
+	want := [][]string{{"a"}, {"b", "c"}, {"d"}}
+	if !levelsEqual(levels, want) {
+		t.Fatalf("got %v, want %v", levels, want)
+	}
+}
+
+func TestLevelsFromParentsCycle(t *testing.T) {
+	tables := []string{"a", "b"}
+	parents := map[string]map[string]bool{
+		"a": {"b": true},
+		"b": {"a": true},
+	}
+
+	levels, cycle := levelsFromParents(tables, parents)
+	if !cycle {
+		t.Fatalf("expected cycle, got levels %v", levels)
+	}
+	if levels != nil {
+		t.Fatalf("expected nil levels on cycle, got %v", levels)
+	}
+}
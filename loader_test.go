@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteInfileEscapedNull(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeInfileEscaped(&buf, nil); err != nil {
+		t.Fatalf("writeInfileEscaped: %v", err)
+	}
+	if got := buf.String(); got != `\N` {
+		t.Fatalf("got %q, want %q", got, `\N`)
+	}
+}
+
+func TestWriteInfileEscapedPlain(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeInfileEscaped(&buf, []byte("hello")); err != nil {
+		t.Fatalf("writeInfileEscaped: %v", err)
+	}
+	if got := buf.String(); got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestWriteInfileEscapedSpecialBytes(t *testing.T) {
+	in := []byte("a\\b\tc\nd\re\x00f")
+	want := `a\\b\tc\nd\re\0f`
+
+	var buf bytes.Buffer
+	if err := writeInfileEscaped(&buf, in); err != nil {
+		t.Fatalf("writeInfileEscaped: %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteInfileEscapedBinaryContent(t *testing.T) {
+	in := []byte{0xff, 0x00, 0x01, '\t', 0xfe}
+	want := []byte{0xff, '\\', '0', 0x01, '\\', 't', 0xfe}
+
+	var buf bytes.Buffer
+	if err := writeInfileEscaped(&buf, in); err != nil {
+		t.Fatalf("writeInfileEscaped: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestWriteInfileEscapedEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeInfileEscaped(&buf, []byte{}); err != nil {
+		t.Fatalf("writeInfileEscaped: %v", err)
+	}
+	if got := buf.String(); got != "" {
+		t.Fatalf("got %q", got)
+	}
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/signal"
 	"runtime/pprof"
@@ -40,6 +38,25 @@ type (
 		table   string
 		where   string
 		columns []string
+
+		// disableFKChecks is true only when orderByDependencies found a
+		// dependency cycle (or the run is a single table, which carries no
+		// ordering guarantee to begin with). Otherwise foreign_key_checks
+		// is left on so the computed dependency order is actually load
+		// bearing instead of a no-op sort.
+		disableFKChecks bool
+
+		// Connection tuning, set from flags in main() via Connect()
+		tls             string
+		charset         string
+		collation       string
+		params          map[string]string
+		timeout         time.Duration
+		readTimeout     time.Duration
+		writeTimeout    time.Duration
+		maxOpenConns    int
+		maxIdleConns    int
+		connMaxLifetime time.Duration
 	}
 )
 
@@ -65,7 +82,10 @@ func showUsage() {
 	-srcport: Source MySQL Port (3306 default)
 	-srcsocket: Source MySQL Socket File
 	-srctable: Fully Qualified Source Tablename: ex. schema.tablename (required)
+	            Also accepts a comma separated list (schema.t1,schema.t2), a glob
+	            (schema.*) or a bare schema name to copy every table in it.
 	-where: Where clause to apply to source table select
+	-srctls: Source TLS mode: false|skip-verify|preferred|true|<registered name> (skip-verify default)
 
 	TARGET DATABASE FLAGS
 	=====================
@@ -74,10 +94,33 @@ func showUsage() {
 	-tgthost: Target Database (required)
 	-tgtport: Target MySQL Port (3306 default)
 	-tgtsocket: Target MySQL Socket File
-	-tgttable: Fully Qualified Target Tablename: ex. schema.tablename (source tablename used if blank)
+	-tgttable: Fully Qualified Target Tablename: ex. schema.tablename (source tablename used if blank, only valid when copying a single table)
 	-ignore: Do insert ignore's and enable the -append flag (false default)
 	-append: Don't drop the destination table before copying (false default)
-
+	-tgttls: Target TLS mode: false|skip-verify|preferred|true|<registered name> (skip-verify default)
+	-parallel: Number of tables to copy concurrently (1 default)
+	-chunk-size: Rows to copy per primary-key range chunk (50000 default)
+	-resume-file: File to persist chunk progress so an interrupted copy can resume (disabled if blank)
+	-loader: Bulk load method to use on the target: infile or insert (infile default, falls back to insert if local_infile is OFF)
+	-consistent: Read each table inside a REPEATABLE READ consistent snapshot and report its binlog/GTID coordinates (false default)
+	-coords-out: File to write -consistent coordinates to as JSON (stdout only if blank)
+	-verify: Checksum source and target after copying and report any mismatched ranges (false default)
+	-verify-only: Checksum an already-copied table instead of copying it; implies -verify (false default)
+	-verify-min-chunk: Smallest row range -verify will bisect a mismatch down to before listing individual keys (1000 default)
+
+	CONNECTION FLAGS
+	================
+	-tls-ca/-tls-cert/-tls-key: Material registered for any -srctls/-tgttls value that isn't a built-in mode
+	-timeout/-read-timeout/-write-timeout: Dial/read/write timeouts, e.g. 30s (none if blank)
+	-charset/-collation: Connection character set/collation
+	-params: Additional driver parameter as key=val, repeatable
+	-max-open-conns/-max-idle-conns/-conn-max-lifetime: Pool sizing per host (unlimited if 0, except -max-idle-conns which keeps the driver default if 0)
+
+	OBSERVABILITY FLAGS
+	====================
+	-log-level: Minimum level to log: debug|info|warn|error (info default)
+	-log-format: Log output format: text|json (text default)
+	-metrics-addr: Address to serve Prometheus /metrics and /healthz on, e.g. :9090 (disabled if blank)
 
 	DEBUG FLAGS
 	===========
@@ -107,6 +150,7 @@ func main() {
 	fSrcSock := flag.String("srcsocket", "", "Source MySQL Socket File")
 	fSrcTable := flag.String("srctable", "", "Fully Qualified Source Tablename: ex. schema.tablename (required)")
 	fSrcWhere := flag.String("where", "", "Where clause to apply to source table select")
+	fSrcTLS := flag.String("srctls", "", "Source TLS mode: false|skip-verify|preferred|true|<registered name> (skip-verify default)")
 
 	// Target flags
 	fTgtUser := flag.String("tgtuser", "", "Target Username (source username used if blank)")
@@ -116,6 +160,38 @@ func main() {
 	fTgtTable := flag.String("tgttable", "", "Fully Qualified Target Tablename: ex. schema.tablename (source tablename used if blank)")
 	fTgtIgnore := flag.Bool("ignore", false, "Do insert ignore's and enable the -append flag")
 	fTgtAppend := flag.Bool("append", false, "Don't drop the destination table before copying")
+	fTgtTLS := flag.String("tgttls", "", "Target TLS mode: false|skip-verify|preferred|true|<registered name> (skip-verify default)")
+
+	// Connection flags shared by source and target
+	fTLSCA := flag.String("tls-ca", "", "CA cert file, registered for any -srctls/-tgttls value that isn't a built-in mode")
+	fTLSCert := flag.String("tls-cert", "", "Client cert file for the registered TLS config")
+	fTLSKey := flag.String("tls-key", "", "Client key file for the registered TLS config")
+	fTimeout := flag.Duration("timeout", 0, "Dial timeout, e.g. 5s (driver default if 0)")
+	fReadTimeout := flag.Duration("read-timeout", 0, "I/O read timeout, e.g. 30s (none if 0)")
+	fWriteTimeout := flag.Duration("write-timeout", 0, "I/O write timeout, e.g. 30s (none if 0)")
+	fCharset := flag.String("charset", "", "Connection character set")
+	fCollation := flag.String("collation", "", "Connection collation")
+	fParams := make(paramsFlag)
+	flag.Var(fParams, "params", "Additional driver parameter as key=val, repeatable")
+	fMaxOpenConns := flag.Int("max-open-conns", 0, "Maximum open connections per host (unlimited if 0)")
+	fMaxIdleConns := flag.Int("max-idle-conns", 0, "Maximum idle connections per host (driver default if 0)")
+	fConnMaxLifetime := flag.Duration("conn-max-lifetime", 0, "Maximum lifetime of a pooled connection, e.g. 1h (unlimited if 0)")
+
+	// Job flags
+	fParallel := flag.Int("parallel", 1, "Number of tables to copy concurrently")
+	fChunkSize := flag.Int("chunk-size", 50000, "Number of rows to copy per primary-key range chunk")
+	fResumeFile := flag.String("resume-file", "", "File to persist chunk progress in so an interrupted copy can resume (disabled if blank)")
+	fLoader := flag.String("loader", "infile", "Bulk load method to use on the target: infile or insert")
+	fConsistent := flag.Bool("consistent", false, "Read each table inside a REPEATABLE READ consistent snapshot and report its binlog/GTID coordinates")
+	fCoordsOut := flag.String("coords-out", "", "File to write captured -consistent binlog/GTID coordinates to, as JSON (stdout only if blank)")
+	fVerify := flag.Bool("verify", false, "Checksum source and target after copying and report any mismatched ranges")
+	fVerifyOnly := flag.Bool("verify-only", false, "Checksum an already-copied table instead of copying it; implies -verify")
+	fMinVerifyChunk := flag.Int("verify-min-chunk", 1000, "Smallest row range -verify will bisect a mismatch down to before listing individual keys")
+
+	// Observability flags
+	fLogLevel := flag.String("log-level", "info", "Minimum level to log: debug|info|warn|error")
+	fLogFormat := flag.String("log-format", "text", "Log output format: text|json")
+	fMetricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus /metrics and /healthz on, e.g. :9090 (disabled if blank)")
 
 	// Other flags
 	version := flag.Bool("version", false, "Version information")
@@ -137,6 +213,9 @@ func main() {
 		os.Exit(0)
 	}
 
+	logger = newLogger(*fLogLevel, *fLogFormat)
+	startMetricsServer(*fMetricsAddr)
+
 	// CPU Profiling
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -152,15 +231,19 @@ func main() {
 
 	// Need to provide a target database
 	if *fTgtHost == "" {
-		fmt.Fprintln(os.Stderr, "You must provide a target database")
+		logger.Errorf("you must provide a target database")
+		os.Exit(1)
+	}
+
+	// A source table, list, glob or schema must be provided
+	if *fSrcTable == "" {
+		logger.Errorf("you must provide a source table, comma separated list, glob or schema to move")
 		os.Exit(1)
 	}
 
-	// A fully qualified table must be provided
-	if *fTgtTable == "" && *fSrcTable != "" {
-		*fTgtTable = *fSrcTable
-	} else if *fSrcTable == "" || !strings.Contains(*fSrcTable, ".") {
-		fmt.Fprintln(os.Stderr, "You must provide a fully qualifed table to move")
+	// -tgttable only makes sense when copying a single table
+	if *fTgtTable != "" && (strings.Contains(*fSrcTable, ",") || strings.Contains(*fSrcTable, "*") || !strings.Contains(*fSrcTable, ".")) {
+		logger.Errorf("-tgttable can only be used when -srctable names a single fully qualified table")
 		os.Exit(1)
 	}
 
@@ -198,59 +281,98 @@ func main() {
 		*fSrcWhere = " where " + *fSrcWhere
 	}
 
-	// Split the table into schema and table name
-	srcSplit := strings.Split(*fSrcTable, ".")
-	tgtSplit := strings.Split(*fTgtTable, ".")
+	// Register a custom TLS config for any -srctls/-tgttls value that isn't
+	// one of the driver's built-in modes.
+	if !builtinTLSModes[*fSrcTLS] {
+		if err := registerTLSConfig(*fSrcTLS, *fTLSCA, *fTLSCert, *fTLSKey); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
+	if !builtinTLSModes[*fTgtTLS] && *fTgtTLS != *fSrcTLS {
+		if err := registerTLSConfig(*fTgtTLS, *fTLSCA, *fTLSCert, *fTLSKey); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+	}
 
-	source := dbInfo{user: *fSrcUser, pass: *fSrcPass, host: *fSrcHost, port: *fSrcPort, sock: *fSrcSock, schema: srcSplit[0], table: srcSplit[1], where: *fSrcWhere}
-	target := dbInfo{user: *fTgtUser, pass: *fTgtPass, host: *fTgtHost, port: *fTgtPort, schema: tgtSplit[0], table: tgtSplit[1]}
+	connTuning := func(tlsMode string) dbInfo {
+		return dbInfo{
+			tls:             tlsMode,
+			charset:         *fCharset,
+			collation:       *fCollation,
+			params:          fParams,
+			timeout:         *fTimeout,
+			readTimeout:     *fReadTimeout,
+			writeTimeout:    *fWriteTimeout,
+			maxOpenConns:    *fMaxOpenConns,
+			maxIdleConns:    *fMaxIdleConns,
+			connMaxLifetime: *fConnMaxLifetime,
+		}
+	}
 
-	// Create a *sql.DB connection to the source database
-	sourceDB, err := source.Connect()
-	defer sourceDB.Close()
+	source := connTuning(*fSrcTLS)
+	source.user, source.pass, source.host, source.port, source.sock, source.where = *fSrcUser, *fSrcPass, *fSrcHost, *fSrcPort, *fSrcSock, *fSrcWhere
+
+	target := connTuning(*fTgtTLS)
+	target.user, target.pass, target.host, target.port = *fTgtUser, *fTgtPass, *fTgtHost, *fTgtPort
+
+	// Create a *sql.DB connection to the source database, pooled so every
+	// table job copying from this host shares it.
+	pooledSrc, err := pool.get(source)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
-	source.db = sourceDB
 
-	// Create a *sql.DB connection to the target database
-	targetDB, err := target.Connect()
-	defer targetDB.Close()
+	// Resolve -srctable into one or more fully qualified tables: it may be a
+	// single table, a comma separated list, a glob or a bare schema name.
+	tables, err := resolveTables(pooledSrc, *fSrcTable)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+	if len(tables) == 0 {
+		logger.Errorf("no tables matched -srctable %s", *fSrcTable)
 		os.Exit(1)
 	}
-	target.db = targetDB
-
-	// Get create table statement
-	createStmt := source.getCreateTable()
 
-	// Get table column data types
-	target.columns = source.getDataTypes()
+	// Group parent tables into dependency levels ahead of the children that
+	// reference them; falls back to a single level in the original order
+	// (foreign_key_checks=0) on a cycle. runJobs copies a whole level
+	// concurrently and barriers before starting the next, so the order
+	// actually means something instead of just being a sort on the log.
+	levels, cycle, err := orderByDependencies(pooledSrc, tables)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
 
-	// Only (re)create the schema & table if not appending
-	if *fTgtAppend == false {
-		// Create the target schema if it does not already exist
-		createSchema(&source, &target, *verbose)
+	// A single table carries no ordering guarantee to begin with, so keep
+	// disabling foreign_key_checks for it the same way this program always
+	// has; for a genuine multi-level, cycle-free plan leave checks on so
+	// the computed order is load bearing.
+	disableFKChecks := cycle || len(tables) < 2
 
-		// Drop and recreate the target table
-		createTable(&source, &target, createStmt)
+	jobLevels, err := buildJobLevels(source, target, levels, *fTgtTable, disableFKChecks)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
 	}
 
-	// Create communication channels
-	dataChan := make(chan []sql.RawBytes)
-	quitChan := make(chan bool)
-	goChan := make(chan bool)
+	resume, err := loadResumeState(*fResumeFile)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
 
-	// Start reading and writing
-	go readRows(&source, &target, dataChan, quitChan, goChan)
-	rowCount := target.writeRows(dataChan, goChan, *verbose, *fTgtIgnore)
+	rowCount, coords, failures := runJobs(jobLevels, *fParallel, *fTgtAppend, *fTgtIgnore, *verbose, *fChunkSize, resume, *fLoader, *fConsistent, *fVerify || *fVerifyOnly, *fVerifyOnly, *fMinVerifyChunk)
 
-	// Block on quitChan until readRows() completes
-	<-quitChan
-	close(quitChan)
-	close(goChan)
+	if *fConsistent {
+		if err := reportCoords(coords, *fCoordsOut); err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
 
 	// Memory Profiling
 	if *memprofile != "" {
@@ -261,17 +383,24 @@ func main() {
 	}
 
 	if *verbose {
-		fmt.Println()
-		fmt.Println()
-		fmt.Println(rowCount, "rows written")
-		fmt.Println("Total runtime =", time.Since(start))
+		logger.Infof("%d rows written", rowCount)
+		logger.Infof("total runtime = %v", time.Since(start))
+	}
+
+	// A partially failed multi-table/parallel run must not exit 0 - a
+	// script or CI job gating on exit code needs to see the failure.
+	if failures > 0 {
+		logger.Errorf("%d of %d table(s) failed", failures, len(tables))
+		os.Exit(1)
 	}
 }
 
-// Pass the buck error catching
+// checkErr logs a fatal error and exits, rather than panicking and dumping a
+// goroutine stack trace mid-transaction.
 func checkErr(e error) {
 	if e != nil {
-		log.Panic(e)
+		logger.Errorf("%v", e)
+		os.Exit(1)
 	}
 }
 
@@ -317,281 +446,3 @@ func catchNotifications() {
 	}()
 }
 
-// Create and return a database handle
-func (dbi *dbInfo) Connect() (*sql.DB, error) {
-	var db *sql.DB
-	var err error
-	if dbi.sock != "" {
-		db, err = sql.Open("mysql", dbi.user+":"+dbi.pass+"@unix("+dbi.sock+")/?allowCleartextPasswords=1&tls=skip-verify")
-		checkErr(err)
-	} else if dbi.host != "" {
-		db, err = sql.Open("mysql", dbi.user+":"+dbi.pass+"@tcp("+dbi.host+":"+dbi.port+")/?allowCleartextPasswords=1&tls=skip-verify")
-	}
-
-	// Ping database to verify credentials
-	err = db.Ping()
-
-	return db, err
-}
-
-// Adds backtick quotes in cases where identifiers are all numeric or match reserved keywords
-func addQuotes(s string) string {
-	s = "`" + s + "`"
-	return s
-}
-
-// Get create table statement
-func (dbi *dbInfo) getCreateTable() string {
-	var err error
-	var ignore string
-	var stmt string
-	err = dbi.db.QueryRow("show create table "+addQuotes(dbi.schema)+"."+addQuotes(dbi.table)).Scan(&ignore, &stmt)
-	checkErr(err)
-
-	return stmt
-}
-
-// Get column data types
-func (dbi *dbInfo) getDataTypes() []string {
-	var cols = []string{}
-	rows, err := dbi.db.Query("select data_type from information_schema.columns where table_schema = '" + dbi.schema + "' and table_name = '" + dbi.table + "'")
-	defer rows.Close()
-	checkErr(err)
-
-	var dataType string
-	for rows.Next() {
-		err = rows.Scan(&dataType)
-		checkErr(err)
-
-		cols = append(cols, dataType)
-	}
-	checkErr(err)
-
-	return cols
-}
-
-// Create the target schema if it does not already exist
-func createSchema(src, tgt *dbInfo, verbose bool) {
-	var exists string
-	err := tgt.db.QueryRow("show databases like '" + tgt.schema + "'").Scan(&exists)
-
-	if err != nil {
-		var charSet string
-		err := src.db.QueryRow("select default_character_set_name from information_schema.schemata where schema_name = '" + src.schema + "'").Scan(&charSet)
-
-		_, err = tgt.db.Exec("create database " + addQuotes(tgt.schema) + " default character set " + charSet)
-		checkErr(err)
-
-		if verbose {
-			fmt.Println("       Created schema", tgt.schema)
-		}
-	}
-}
-
-// Drop and recreate the target table
-func createTable(src, tgt *dbInfo, tableCreate string) {
-	// Start db transaction
-	tx, err := tgt.db.Begin()
-	checkErr(err)
-
-	// Turn off foreign key checks
-	_, err = tx.Exec("set foreign_key_checks=0")
-	checkErr(err)
-
-	_, err = tx.Exec("use " + tgt.schema)
-
-	// Drop table if exists
-	_, err = tx.Exec("drop table if exists " + addQuotes(tgt.table))
-	checkErr(err)
-
-	// Change table name if different
-	if src.table != tgt.table {
-		tableCreate = strings.Replace(tableCreate, src.table, tgt.table, 1)
-	}
-
-	// Create table
-	_, err = tx.Exec(tableCreate)
-	checkErr(err)
-
-	// Commit transaction
-	err = tx.Commit()
-	checkErr(err)
-}
-
-// readRows executes a query and sends each row over a channel to be consumed
-func readRows(src, tgt *dbInfo, dataChan chan []sql.RawBytes, quitChan chan bool, goChan chan bool) {
-	rows, err := src.db.Query("select * from " + addQuotes(src.schema) + "." + addQuotes(src.table) + src.where)
-	defer rows.Close()
-	if err != nil {
-		log.Print(err)
-		os.Exit(11)
-	}
-
-	cols, err := rows.Columns()
-	checkErr(err)
-
-	// Need to scan into empty interface since we don't know how many columns a query might return
-	scanVals := make([]interface{}, len(cols))
-	vals := make([]sql.RawBytes, len(cols))
-	for i := range vals {
-		scanVals[i] = &vals[i]
-	}
-
-	for rows.Next() {
-		err := rows.Scan(scanVals...)
-		checkErr(err)
-
-		dataChan <- vals
-
-		// Block and wait for writeRows() to signal back it has consumed the data
-		// This is necessary because sql.RawBytes is a memory pointer and when rows.Next()
-		// loops and change the memory address before writeRows can properly process the values
-		<-goChan
-	}
-
-	err = rows.Err()
-	checkErr(err)
-
-	close(dataChan)
-	quitChan <- true
-}
-
-// writeRows receives data via a channel from readRows, wraps insert syntax around it, bulks statements up to insertBufferSize and then executes against the target database
-func (dbi *dbInfo) writeRows(dataChan chan []sql.RawBytes, goChan chan bool, verbose bool, ignore bool) uint {
-	var rowsWritten uint
-	var verboseCount uint
-	buf := bytes.NewBuffer(make([]byte, 0, insertBufferSize))
-
-	if verbose {
-		fmt.Println("A '.' will be shown for every 10,000 CSV rows written")
-	}
-
-	var sqlPrefix string
-	if ignore {
-		sqlPrefix = "insert ignore into " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + " values ("
-	} else {
-		sqlPrefix = "insert into " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + " values ("
-	}
-	prefixLength, _ := buf.WriteString(sqlPrefix)
-
-	appendSQL := false
-	for data := range dataChan {
-		if appendSQL {
-			buf.WriteString(",(")
-		}
-		appendSQL = true
-
-		for i, col := range data {
-			if col == nil {
-				buf.WriteString("NULL")
-			} else if len(col) == 0 {
-				buf.WriteString("''")
-			} else {
-				switch dbi.columns[i] {
-				case "tinytext":
-					fallthrough
-				case "text":
-					fallthrough
-				case "mediumtext":
-					fallthrough
-				case "longtext":
-					fallthrough
-				case "char":
-					fallthrough
-				case "varchar":
-					if bytes.IndexAny(col, `\'`) >= 0 {
-						col = bytes.Replace(col, []byte(`\`), []byte(`\\`), -1)
-						col = bytes.Replace(col, []byte(`'`), []byte(`\'`), -1)
-					}
-					fallthrough
-				default:
-					buf.WriteString("'")
-					buf.Write(col)
-					buf.WriteString("'")
-				}
-			}
-
-			// All fields but the last one are comma delimited
-			if i < len(dbi.columns)-1 {
-				buf.WriteString(",")
-			}
-		}
-
-		buf.WriteString(")")
-
-		// Visual write indicator when verbose is enabled
-		rowsWritten++
-		if verbose {
-			verboseCount++
-			if verboseCount == 10000 {
-				fmt.Printf(".")
-				verboseCount = 0
-			}
-		}
-
-		// Execute insert statement if greater than insertBufferSize
-		if buf.Len() > insertBufferSize {
-			// Start db transaction
-			tx, err := dbi.db.Begin()
-			checkErr(err)
-
-			// Turn off foreign key checks
-			_, err = tx.Exec("set foreign_key_checks=0")
-			checkErr(err)
-
-			// Use schema
-			_, err = tx.Exec("use " + addQuotes(dbi.schema))
-			checkErr(err)
-
-			//buf.WriteTo(os.Stdout) // DEBUG
-			//fmt.Println()          // DEBUG
-			_, err = tx.Exec(buf.String())
-			if err != nil {
-				fmt.Fprintln(os.Stderr)
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(11)
-			}
-
-			// Commit transaction
-			err = tx.Commit()
-			checkErr(err)
-
-			buf.Reset()
-			buf.WriteString(sqlPrefix)
-			appendSQL = false
-		}
-
-		// Signal back to readRows() it can loop and scan the next row
-		goChan <- true
-	}
-
-	// Insert remaining rows
-	if buf.Len() > prefixLength {
-		// Start db transaction
-		tx, err := dbi.db.Begin()
-		checkErr(err)
-
-		// Turn off foreign key checks
-		_, err = tx.Exec("set foreign_key_checks=0")
-		checkErr(err)
-
-		// Use schema
-		_, err = tx.Exec("use " + addQuotes(dbi.schema))
-		checkErr(err)
-
-		//buf.WriteTo(os.Stdout) // DEBUG
-		//fmt.Println()          // DEBUG
-		_, err = tx.Exec(buf.String())
-		if err != nil {
-			fmt.Fprintln(os.Stderr)
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(11)
-		}
-
-		// Commit transaction
-		err = tx.Commit()
-		checkErr(err)
-	}
-
-	return rowsWritten
-}
@@ -0,0 +1,139 @@
+package main
+
+// getPrimaryKeyColumns returns the column names that chunked copying should
+// walk in key order: the table's primary key if it has one, otherwise the
+// first fully NOT NULL unique key, in that key's own column order. It
+// returns an empty slice (not an error) when the table has neither, so
+// callers can fall back to LIMIT/OFFSET pagination as a last resort.
+func getPrimaryKeyColumns(dbi *dbInfo) ([]string, error) {
+	cols, err := indexColumns(dbi, "PRIMARY")
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) > 0 {
+		return cols, nil
+	}
+
+	return firstUniqueKeyColumns(dbi)
+}
+
+// indexColumns returns the column names making up the named index, in key
+// order.
+func indexColumns(dbi *dbInfo, indexName string) ([]string, error) {
+	rows, err := dbi.db.Query(`
+		select column_name
+		from information_schema.statistics
+		where table_schema = ? and table_name = ? and index_name = ?
+		order by seq_in_index`, dbi.schema, dbi.table, indexName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+
+	return cols, rows.Err()
+}
+
+// firstUniqueKeyColumns returns the columns of the first unique key on the
+// table (ordered by index name for a deterministic pick) that has no
+// nullable column, or nil if none qualifies. A unique key with a nullable
+// column is skipped because MySQL allows multiple NULLs in it, so it can't
+// provide the distinct, total row order chunk boundaries depend on.
+func firstUniqueKeyColumns(dbi *dbInfo) ([]string, error) {
+	rows, err := dbi.db.Query(`
+		select s.index_name, s.column_name, c.is_nullable
+		from information_schema.statistics s
+		join information_schema.columns c
+		  on c.table_schema = s.table_schema and c.table_name = s.table_name and c.column_name = s.column_name
+		where s.table_schema = ? and s.table_name = ? and s.non_unique = 0 and s.index_name <> 'PRIMARY'
+		order by s.index_name, s.seq_in_index`, dbi.schema, dbi.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexOrder []string
+	cols := map[string][]string{}
+	nullable := map[string]bool{}
+
+	for rows.Next() {
+		var indexName, colName, isNullable string
+		if err := rows.Scan(&indexName, &colName, &isNullable); err != nil {
+			return nil, err
+		}
+
+		if _, seen := cols[indexName]; !seen {
+			indexOrder = append(indexOrder, indexName)
+		}
+		cols[indexName] = append(cols[indexName], colName)
+		if isNullable == "YES" {
+			nullable[indexName] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range indexOrder {
+		if !nullable[name] {
+			return cols[name], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// pkPredicate builds the lexicographic "greater than" predicate used to find
+// the next chunk boundary for a (possibly composite) primary key, e.g. for
+// columns (a, b) it returns:
+//
+//	(`a` > ? or (`a` = ? and `b` > ?))
+//
+// along with the bind arguments in the order they appear in the predicate.
+// lowerBound is nil for the first chunk, in which case no predicate is
+// needed at all.
+func pkPredicate(cols []string, lowerBound []string) (string, []interface{}) {
+	if lowerBound == nil {
+		return "", nil
+	}
+
+	var clauses []string
+	var args []interface{}
+
+	for i := range cols {
+		var eq []string
+		for j := 0; j < i; j++ {
+			eq = append(eq, addQuotes(cols[j])+" = ?")
+			args = append(args, lowerBound[j])
+		}
+		eq = append(eq, addQuotes(cols[i])+" > ?")
+		args = append(args, lowerBound[i])
+
+		clause := eq[0]
+		for _, e := range eq[1:] {
+			clause += " and " + e
+		}
+		if len(eq) > 1 {
+			clause = "(" + clause + ")"
+		}
+		clauses = append(clauses, clause)
+	}
+
+	predicate := clauses[0]
+	for _, c := range clauses[1:] {
+		predicate += " or " + c
+	}
+	if len(clauses) > 1 {
+		predicate = "(" + predicate + ")"
+	}
+
+	return predicate, args
+}
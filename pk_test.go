@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPkPredicateFirstChunk(t *testing.T) {
+	predicate, args := pkPredicate([]string{"id"}, nil)
+	if predicate != "" || args != nil {
+		t.Fatalf("got predicate %q args %v, want empty", predicate, args)
+	}
+}
+
+func TestPkPredicateSingleColumn(t *testing.T) {
+	predicate, args := pkPredicate([]string{"id"}, []string{"5"})
+	wantPredicate := "`id` > ?"
+	if predicate != wantPredicate {
+		t.Fatalf("got predicate %q, want %q", predicate, wantPredicate)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"5"}) {
+		t.Fatalf("got args %v", args)
+	}
+}
+
+func TestPkPredicateComposite(t *testing.T) {
+	predicate, args := pkPredicate([]string{"a", "b"}, []string{"1", "2"})
+	wantPredicate := "(`a` > ? or (`a` = ? and `b` > ?))"
+	if predicate != wantPredicate {
+		t.Fatalf("got predicate %q, want %q", predicate, wantPredicate)
+	}
+	wantArgs := []interface{}{"1", "1", "2"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("got args %v, want %v", args, wantArgs)
+	}
+}
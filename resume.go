@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// resumeEntry records how far a table's chunked copy got so an interrupted
+// run can pick back up instead of truncating and starting over. Columns and
+// Values are empty when the table has neither a primary key nor a usable
+// unique key; Offset then holds the LIMIT offset instead.
+type resumeEntry struct {
+	Columns []string `json:"columns,omitempty"`
+	Values  []string `json:"values,omitempty"`
+	Offset  int64    `json:"offset,omitempty"`
+	Done    bool     `json:"done,omitempty"`
+}
+
+// resumeState maps "schema.table" to its last persisted chunk boundary.
+// Access is serialized with a mutex since multiple table jobs may share one
+// -resume-file under -parallel.
+type resumeState struct {
+	mu   sync.Mutex
+	path string
+	data map[string]resumeEntry
+}
+
+// loadResumeState reads path if it exists, returning an empty state
+// otherwise. path == "" disables resume entirely.
+func loadResumeState(path string) (*resumeState, error) {
+	s := &resumeState{path: path, data: map[string]resumeEntry{}}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.data); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// get returns the persisted boundary for a table, if any.
+func (s *resumeState) get(table string) (resumeEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.data[table]
+	return e, ok
+}
+
+// set records table's latest chunk boundary and flushes the whole state to
+// disk. Writing on every chunk keeps resume data consistent with what has
+// actually been committed to the target, at the cost of an extra file write
+// per chunk. The write goes to a temp file in the same directory followed by
+// a rename, so a crash or kill mid-write can never leave s.path holding a
+// truncated, corrupt JSON document - the rename is atomic and either lands
+// the old or the new complete contents.
+func (s *resumeState) set(table string, e resumeEntry) error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[table] = e
+
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
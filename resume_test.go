@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeStateSetWritesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resume.json")
+
+	s, err := loadResumeState(path)
+	if err != nil {
+		t.Fatalf("loadResumeState: %v", err)
+	}
+
+	entry := resumeEntry{Columns: []string{"id"}, Values: []string{"10"}}
+	if err := s.set("db.t1", entry); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp-*"))
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("temp file left behind: %v", matches)
+	}
+
+	reloaded, err := loadResumeState(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, ok := reloaded.get("db.t1")
+	if !ok {
+		t.Fatal("entry missing after reload")
+	}
+	if got.Values[0] != "10" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestResumeStateSetPreservesOtherTables(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resume.json")
+
+	s, err := loadResumeState(path)
+	if err != nil {
+		t.Fatalf("loadResumeState: %v", err)
+	}
+
+	if err := s.set("db.t1", resumeEntry{Done: true}); err != nil {
+		t.Fatalf("set t1: %v", err)
+	}
+	if err := s.set("db.t2", resumeEntry{Offset: 42}); err != nil {
+		t.Fatalf("set t2: %v", err)
+	}
+
+	reloaded, err := loadResumeState(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	t1, ok := reloaded.get("db.t1")
+	if !ok || !t1.Done {
+		t.Fatalf("t1 entry lost or wrong: %v ok=%v", t1, ok)
+	}
+	t2, ok := reloaded.get("db.t2")
+	if !ok || t2.Offset != 42 {
+		t.Fatalf("t2 entry lost or wrong: %v ok=%v", t2, ok)
+	}
+}
+
+func TestResumeStateNoPathIsNoop(t *testing.T) {
+	s, err := loadResumeState("")
+	if err != nil {
+		t.Fatalf("loadResumeState: %v", err)
+	}
+	if err := s.set("db.t1", resumeEntry{Done: true}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, ok := s.get("db.t1"); ok {
+		t.Fatal("expected no entry to be persisted without a path")
+	}
+}
+
+func TestLoadResumeStateMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := loadResumeState(filepath.Join(dir, "does-not-exist.json"))
+	if err != nil {
+		t.Fatalf("loadResumeState: %v", err)
+	}
+	if _, ok := s.get("db.t1"); ok {
+		t.Fatal("expected empty state")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "does-not-exist.json")); !os.IsNotExist(err) {
+		t.Fatal("loadResumeState should not create the file")
+	}
+}
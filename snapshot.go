@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// binlogCoords is the replication position captured at the moment a
+// consistent snapshot was opened, in the same spirit as mysqldump's
+// --master-data output - enough to seed CHANGE MASTER TO on the target.
+type binlogCoords struct {
+	Table        string `json:"table"`
+	File         string `json:"binlog_file"`
+	Position     uint32 `json:"binlog_pos"`
+	GTIDExecuted string `json:"gtid_executed"`
+}
+
+// startConsistentSnapshot opens a dedicated connection, switches it to
+// REPEATABLE READ and starts a consistent snapshot transaction on it, then
+// captures the binlog file/position and GTID set that snapshot corresponds
+// to. The returned *sql.Conn stays open (and the transaction uncommitted)
+// until the caller is done reading - all reads must go through this
+// connection rather than dbi.db for the snapshot to mean anything.
+func startConsistentSnapshot(ctx context.Context, dbi *dbInfo) (*sql.Conn, binlogCoords, error) {
+	conn, err := dbi.db.Conn(ctx)
+	if err != nil {
+		return nil, binlogCoords{}, err
+	}
+
+	if _, err := conn.ExecContext(ctx, "set session transaction isolation level repeatable read"); err != nil {
+		conn.Close()
+		return nil, binlogCoords{}, err
+	}
+
+	// Hold a brief global read lock across START TRANSACTION WITH CONSISTENT
+	// SNAPSHOT and the position read, the same way mysqldump
+	// --single-transaction --master-data does. Without it, a transaction
+	// that commits between those two statements is invisible to the
+	// snapshot's read view but already reflected in SHOW MASTER STATUS, so
+	// the reported binlog/GTID position would point past content the
+	// snapshot never saw - seeding a replica from it would silently skip
+	// that transaction.
+	if _, err := conn.ExecContext(ctx, "flush tables with read lock"); err != nil {
+		conn.Close()
+		return nil, binlogCoords{}, err
+	}
+
+	if _, err := conn.ExecContext(ctx, "start transaction with consistent snapshot"); err != nil {
+		conn.ExecContext(ctx, "unlock tables")
+		conn.Close()
+		return nil, binlogCoords{}, err
+	}
+
+	// From here on a transaction is open on conn, and database/sql has no
+	// idea: every error return must roll it back before closing, otherwise
+	// Close() returns the physical connection to the pool with the
+	// transaction (and the REPEATABLE READ isolation level) still live for
+	// whatever unrelated query the pool hands it to next.
+	coords, err := readBinlogCoords(ctx, conn, dbi)
+
+	// The snapshot's read view was already fixed by START TRANSACTION above,
+	// so it's safe to let writes resume again as soon as the position (or
+	// the error trying to read it) has been captured - the global lock must
+	// not be held for the rest of the copy.
+	if _, unlockErr := conn.ExecContext(ctx, "unlock tables"); unlockErr != nil {
+		logger.Warnf("unlocking tables after snapshot start: %v", unlockErr)
+	}
+
+	if err != nil {
+		abortSnapshot(ctx, conn)
+		return nil, binlogCoords{}, err
+	}
+
+	return conn, coords, nil
+}
+
+// readBinlogCoords reads SHOW MASTER STATUS (falling back to
+// @@global.gtid_executed when the GTID set isn't in that output) while conn
+// still holds the FLUSH TABLES WITH READ LOCK taken in startConsistentSnapshot.
+func readBinlogCoords(ctx context.Context, conn *sql.Conn, dbi *dbInfo) (binlogCoords, error) {
+	coords := binlogCoords{Table: dbi.schema + "." + dbi.table}
+
+	rows, err := conn.QueryContext(ctx, "show master status")
+	if err != nil {
+		return binlogCoords{}, err
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return binlogCoords{}, err
+	}
+
+	if rows.Next() {
+		vals := make([]sql.RawBytes, len(cols))
+		scanVals := make([]interface{}, len(cols))
+		for i := range vals {
+			scanVals[i] = &vals[i]
+		}
+		if err := rows.Scan(scanVals...); err != nil {
+			rows.Close()
+			return binlogCoords{}, err
+		}
+
+		for i, col := range cols {
+			switch col {
+			case "File":
+				coords.File = string(vals[i])
+			case "Position":
+				var pos uint64
+				fmt.Sscanf(string(vals[i]), "%d", &pos)
+				coords.Position = uint32(pos)
+			case "Executed_Gtid_Set":
+				coords.GTIDExecuted = string(vals[i])
+			}
+		}
+	}
+	rows.Close()
+
+	if coords.GTIDExecuted == "" {
+		_ = conn.QueryRowContext(ctx, "select @@global.gtid_executed").Scan(&coords.GTIDExecuted)
+	}
+
+	return coords, nil
+}
+
+// abortSnapshot rolls back the open snapshot transaction and releases the
+// connection, used on every error path in startConsistentSnapshot once the
+// transaction has been started.
+func abortSnapshot(ctx context.Context, conn *sql.Conn) {
+	if _, err := conn.ExecContext(ctx, "rollback"); err != nil {
+		logger.Warnf("rolling back snapshot transaction: %v", err)
+	}
+	conn.Close()
+}
+
+// endConsistentSnapshot commits the still-open snapshot transaction (it is
+// read-only, so there is nothing to roll back) and releases the connection.
+func endConsistentSnapshot(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "commit")
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// reportCoords prints the captured replication coordinates and, if
+// coordsOut is non-empty, writes them as a JSON array to that file, replacing
+// any previous contents, so they can be fed into CHANGE MASTER TO ... FOR
+// CHANNEL on the target.
+func reportCoords(all []binlogCoords, coordsOut string) error {
+	for _, c := range all {
+		fmt.Printf("   %s snapshot at binlog %s:%d (gtid_executed=%s)\n", c.Table, c.File, c.Position, c.GTIDExecuted)
+	}
+
+	if coordsOut == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(coordsOut, b, 0644)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// verifyTable checksums source and target in parallel over fixed-size
+// primary-key range chunks and reports any that disagree. A mismatching
+// chunk is recursively bisected down to minChunk rows so the differing
+// primary keys can be pinpointed instead of just flagging "chunk N differs".
+// It returns true when every chunk matched.
+func verifyTable(source, target *dbInfo, chunkSize, minChunk int) (bool, error) {
+	pkCols, err := getPrimaryKeyColumns(source)
+	if err != nil {
+		return false, err
+	}
+	if len(pkCols) == 0 {
+		return false, fmt.Errorf("-verify requires %s.%s to have a primary key or a not-null unique key", source.schema, source.table)
+	}
+
+	cols, err := getColumnNames(source)
+	if err != nil {
+		return false, err
+	}
+
+	ctx := context.Background()
+	ok := true
+
+	var lowerBound []string
+	for {
+		hi, found, err := nextBoundary(ctx, source, pkCols, lowerBound, chunkSize)
+		if err != nil {
+			return false, err
+		}
+
+		clean, err := compareRange(ctx, source, target, pkCols, cols, lowerBound, hi)
+		if err != nil {
+			return false, err
+		}
+		if !clean {
+			ok = false
+			if err := bisectRange(ctx, source, target, pkCols, cols, lowerBound, hi, minChunk); err != nil {
+				return false, err
+			}
+		}
+
+		if !found {
+			break
+		}
+		lowerBound = hi
+	}
+
+	return ok, nil
+}
+
+// getColumnNames returns dbi's column names in ordinal position order.
+func getColumnNames(dbi *dbInfo) ([]string, error) {
+	rows, err := dbi.db.Query("select column_name from information_schema.columns where table_schema = ? and table_name = ? order by ordinal_position", dbi.schema, dbi.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+
+	return cols, rows.Err()
+}
+
+// nextBoundary finds the primary key value chunkSize rows past lowerBound,
+// i.e. the upper (inclusive) bound of the next chunk. found is false when
+// fewer than chunkSize rows remain, in which case the final chunk runs to
+// the end of the table.
+func nextBoundary(ctx context.Context, src *dbInfo, pkCols []string, lowerBound []string, chunkSize int) ([]string, bool, error) {
+	where, args := rangeWhere(src, pkCols, lowerBound, nil)
+	orderCols := quotedList(pkCols)
+
+	query := "select " + orderCols + " from " + addQuotes(src.schema) + "." + addQuotes(src.table) +
+		where + " order by " + orderCols + " limit 1 offset " + strconv.Itoa(chunkSize-1)
+
+	row := src.db.QueryRowContext(ctx, query, args...)
+
+	vals := make([]sql.RawBytes, len(pkCols))
+	scanVals := make([]interface{}, len(pkCols))
+	for i := range vals {
+		scanVals[i] = &vals[i]
+	}
+
+	if err := row.Scan(scanVals...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	bound := make([]string, len(vals))
+	for i, v := range vals {
+		bound[i] = string(v)
+	}
+
+	return bound, true, nil
+}
+
+// rangeWhere builds the where clause (including the leading " where ")
+// selecting pk > lowerBound and, when hi is non-nil, pk <= hi, layered on
+// top of src's own -where clause.
+func rangeWhere(src *dbInfo, pkCols []string, lowerBound, hi []string) (string, []interface{}) {
+	where := src.where
+	var args []interface{}
+
+	if gt, gtArgs := pkPredicate(pkCols, lowerBound); gt != "" {
+		where = appendPredicate(where, gt)
+		args = append(args, gtArgs...)
+	}
+
+	if hi != nil {
+		// "pk <= hi" is "not (pk > hi)", reusing the same lexicographic
+		// predicate used for the lower bound.
+		gtHi, hiArgs := pkPredicate(pkCols, hi)
+		where = appendPredicate(where, "not ("+gtHi+")")
+		args = append(args, hiArgs...)
+	}
+
+	return where, args
+}
+
+func appendPredicate(where, predicate string) string {
+	if where == "" {
+		return " where " + predicate
+	}
+	return where + " and " + predicate
+}
+
+func quotedList(cols []string) string {
+	q := make([]string, len(cols))
+	for i, c := range cols {
+		q[i] = addQuotes(c)
+	}
+	return strings.Join(q, ", ")
+}
+
+// checksum is a (row count, order-independent checksum) pair for one range
+// of a table. BIT_XOR of each row's CRC32 is order independent, so it
+// tolerates source and target storing rows in different physical order.
+type checksum struct {
+	count int64
+	xor   uint64
+}
+
+func rangeChecksum(ctx context.Context, dbi *dbInfo, pkCols, cols []string, lowerBound, hi []string) (checksum, error) {
+	where, args := rangeWhere(dbi, pkCols, lowerBound, hi)
+
+	// CONCAT_WS drops NULL arguments entirely rather than substituting
+	// anything, so ('x', NULL, 'y') and (NULL, 'x', 'y') would otherwise
+	// concatenate to the same "x#y" and checksum identically. IFNULL forces
+	// a NULL to a value no real column content collides with.
+	concatCols := make([]string, len(cols))
+	for i, c := range cols {
+		concatCols[i] = "ifnull(" + addQuotes(c) + ", '\\x01NULL\\x01')"
+	}
+
+	query := "select count(*), coalesce(bit_xor(cast(crc32(concat_ws('#', " + strings.Join(concatCols, ", ") + ")) as unsigned)), 0) from " +
+		addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + where
+
+	var count int64
+	var xor sql.RawBytes
+	if err := dbi.db.QueryRowContext(ctx, query, args...).Scan(&count, &xor); err != nil {
+		return checksum{}, err
+	}
+
+	x, err := strconv.ParseUint(string(xor), 10, 64)
+	if err != nil {
+		return checksum{}, err
+	}
+
+	return checksum{count: count, xor: x}, nil
+}
+
+// compareRange checksums a range on both sides concurrently and reports
+// whether they agree.
+func compareRange(ctx context.Context, source, target *dbInfo, pkCols, cols []string, lowerBound, hi []string) (bool, error) {
+	var srcSum, tgtSum checksum
+	var srcErr, tgtErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		srcSum, srcErr = rangeChecksum(ctx, source, pkCols, cols, lowerBound, hi)
+	}()
+	go func() {
+		defer wg.Done()
+		tgtSum, tgtErr = rangeChecksum(ctx, target, pkCols, cols, lowerBound, hi)
+	}()
+	wg.Wait()
+
+	if srcErr != nil {
+		return false, srcErr
+	}
+	if tgtErr != nil {
+		return false, tgtErr
+	}
+
+	return srcSum == tgtSum, nil
+}
+
+// bisectRange recursively halves a mismatching range until it's down to
+// minChunk rows (or can't be split further), then diffs the leaf range row
+// by row and prints the primary keys that differ.
+func bisectRange(ctx context.Context, source, target *dbInfo, pkCols, cols []string, lowerBound, hi []string, minChunk int) error {
+	srcSum, err := rangeChecksum(ctx, source, pkCols, cols, lowerBound, hi)
+	if err != nil {
+		return err
+	}
+
+	if srcSum.count <= int64(minChunk) || srcSum.count <= 1 {
+		return printRangeDiff(ctx, source, target, pkCols, cols, lowerBound, hi)
+	}
+
+	mid, found, err := nextBoundary(ctx, source, pkCols, lowerBound, int(srcSum.count/2))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return printRangeDiff(ctx, source, target, pkCols, cols, lowerBound, hi)
+	}
+
+	lowerClean, err := compareRange(ctx, source, target, pkCols, cols, lowerBound, mid)
+	if err != nil {
+		return err
+	}
+	if !lowerClean {
+		if err := bisectRange(ctx, source, target, pkCols, cols, lowerBound, mid, minChunk); err != nil {
+			return err
+		}
+	}
+
+	upperClean, err := compareRange(ctx, source, target, pkCols, cols, mid, hi)
+	if err != nil {
+		return err
+	}
+	if !upperClean {
+		if err := bisectRange(ctx, source, target, pkCols, cols, mid, hi, minChunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printRangeDiff fetches a small range from both sides in full and prints
+// the primary keys that are missing, extra, or have differing column
+// values.
+func printRangeDiff(ctx context.Context, source, target *dbInfo, pkCols, cols []string, lowerBound, hi []string) error {
+	srcRows, err := fetchRange(ctx, source, cols, pkCols, lowerBound, hi)
+	if err != nil {
+		return err
+	}
+	tgtRows, err := fetchRange(ctx, target, cols, pkCols, lowerBound, hi)
+	if err != nil {
+		return err
+	}
+
+	pkIdx := make([]int, len(pkCols))
+	for i, pkCol := range pkCols {
+		for j, c := range cols {
+			if c == pkCol {
+				pkIdx[i] = j
+			}
+		}
+	}
+
+	pkKey := func(row []sql.RawBytes) string {
+		parts := make([]string, len(pkIdx))
+		for i, idx := range pkIdx {
+			parts[i] = string(row[idx])
+		}
+		return strings.Join(parts, "|")
+	}
+
+	srcByKey := make(map[string][]sql.RawBytes, len(srcRows))
+	for _, row := range srcRows {
+		srcByKey[pkKey(row)] = row
+	}
+
+	tgtByKey := make(map[string][]sql.RawBytes, len(tgtRows))
+	for _, row := range tgtRows {
+		tgtByKey[pkKey(row)] = row
+	}
+
+	for key, srcRow := range srcByKey {
+		tgtRow, ok := tgtByKey[key]
+		if !ok {
+			logger.Warnf("missing on target: %s %s", source.schema+"."+source.table, key)
+			continue
+		}
+		for i := range cols {
+			if string(srcRow[i]) != string(tgtRow[i]) {
+				logger.Warnf("mismatch: %s %s column %s", source.schema+"."+source.table, key, cols[i])
+				break
+			}
+		}
+	}
+
+	for key := range tgtByKey {
+		if _, ok := srcByKey[key]; !ok {
+			logger.Warnf("extra on target: %s %s", target.schema+"."+target.table, key)
+		}
+	}
+
+	return nil
+}
+
+func fetchRange(ctx context.Context, dbi *dbInfo, cols, pkCols, lowerBound, hi []string) ([][]sql.RawBytes, error) {
+	where, args := rangeWhere(dbi, pkCols, lowerBound, hi)
+
+	query := "select " + quotedList(cols) + " from " + addQuotes(dbi.schema) + "." + addQuotes(dbi.table) + where
+
+	rows, err := dbi.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out [][]sql.RawBytes
+	for rows.Next() {
+		vals := make([]sql.RawBytes, len(cols))
+		scanVals := make([]interface{}, len(cols))
+		for i := range vals {
+			scanVals[i] = &vals[i]
+		}
+		if err := rows.Scan(scanVals...); err != nil {
+			return nil, err
+		}
+		out = append(out, vals)
+	}
+
+	return out, rows.Err()
+}